@@ -0,0 +1,234 @@
+package sync
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// CacheConfig 配置 NewMapWithCache 创建出来的Map的缓存行为。
+type CacheConfig struct {
+	// TTL 是每个entry的存活时间，<= 0 表示不过期。
+	TTL time.Duration
+
+	// MaxSize 是大致的entry数量上限，<= 0 表示不限制。超出之后由
+	// 后台的janitor按CLOCK近似算法淘汰，不是精确的LRU。
+	MaxSize int
+
+	// OnEvict 在一个entry因为过期或者MaxSize淘汰而被移除时调用，
+	// 不会在用户主动调用Delete/LoadAndDelete时触发。
+	OnEvict func(key, value interface{})
+
+	// SweepInterval 是janitor检查过期/超限entries的周期，<= 0时
+	// 使用默认值（1秒）。
+	SweepInterval time.Duration
+}
+
+// cacheState 持有缓存模式下除entry本身数据外的额外状态：后台janitor
+// 的生命周期控制。它不参与read/dirty协议，只是Map的一个附加字段。
+type cacheState struct {
+	cfg  CacheConfig
+	stop chan struct{}
+	once sync.Once
+}
+
+// cacheValue 是缓存模式下真正存储在 entry.p 里的数据（取代了普通模式
+// 下裸的value），entry的expunged/CAS协议完全不受影响，因为对entry来说
+// cacheValue和其他任何interface{}值一样，只是一个被unsafe.Pointer指着
+// 的数据。
+type cacheValue struct {
+	v               interface{}
+	expiresUnixNano int64 // 0 表示不过期
+	recentlyUsed    int32 // CLOCK近似算法用的1-bit标记，atomic访问
+}
+
+// NewMapWithCache 创建一个带TTL/LRU近似淘汰的Map。返回的仍然是*Map，
+// 和普通Map用法完全一样，只是Load在读到一个过期entry时会表现得像它
+// 从未被Store过。不再使用时应调用Close停掉后台的janitor协程。
+func NewMapWithCache(cfg CacheConfig) *Map {
+	if cfg.SweepInterval <= 0 {
+		cfg.SweepInterval = time.Second
+	}
+	m := &Map{cache: &cacheState{cfg: cfg, stop: make(chan struct{})}}
+	go m.cache.janitor(m)
+	return m
+}
+
+// Close 停止缓存模式Map的后台janitor协程。对普通Map调用是个空操作。
+// 多次调用是安全的。
+func (m *Map) Close() {
+	if m.cache == nil {
+		return
+	}
+	m.cache.once.Do(func() { close(m.cache.stop) })
+}
+
+// wrap 把用户给的value包进cacheValue，打上过期时间和初始的
+// recently-used标记。
+func (cs *cacheState) wrap(value interface{}) interface{} {
+	cv := &cacheValue{v: value, recentlyUsed: 1}
+	if cs.cfg.TTL > 0 {
+		cv.expiresUnixNano = time.Now().UnixNano() + int64(cs.cfg.TTL)
+	}
+	return cv
+}
+
+// unwrapCacheValue 把entry里存的cacheValue还原成用户看到的value。如果
+// 已经过期，原地把entry删掉（复用entry自身的CAS，不经过m.mu），对调用
+// 方表现为没有找到，并触发OnEvict。
+func (m *Map) unwrapCacheValue(key interface{}, e *entry, raw interface{}) (value interface{}, ok bool) {
+	cv, ok := raw.(*cacheValue)
+	if !ok {
+		// 不是缓存模式下写入的数据（理论上不会发生），原样返回。
+		return raw, true
+	}
+	if cv.expiresUnixNano != 0 && cv.expiresUnixNano <= time.Now().UnixNano() {
+		if _, deleted := e.loadAndDelete(); deleted && m.cache.cfg.OnEvict != nil {
+			m.cache.cfg.OnEvict(key, cv.v)
+		}
+		return nil, false
+	}
+	atomic.StoreInt32(&cv.recentlyUsed, 1)
+	return cv.v, true
+}
+
+// unwrap把raw还原成调用方可见的value，不做任何淘汰相关的副作用（不会
+// 触发OnEvict）：用于LoadAndDelete/Swap这类entry已经被整个摘下来的
+// 路径，此时再去"淘汰"已经没有意义，只需要把过期数据当成未找到处理。
+func (cs *cacheState) unwrap(raw interface{}) (value interface{}, ok bool) {
+	cv, ok := raw.(*cacheValue)
+	if !ok {
+		return raw, true
+	}
+	if cv.expiresUnixNano != 0 && cv.expiresUnixNano <= time.Now().UnixNano() {
+		return nil, false
+	}
+	return cv.v, true
+}
+
+// tryCompareAndSwapCached和Map.tryCompareAndSwap逻辑一致，只是entry.p
+// 里存的是cs.wrap过的*cacheValue：比较前要先解包出cv.v，过期的值当成
+// 不匹配处理；替换时要用cs.wrap(new)重新包装一层再存回去。
+func (e *entry) tryCompareAndSwapCached(cs *cacheState, old, new interface{}) bool {
+	for {
+		p := atomic.LoadPointer(&e.p)
+		if p == nil || p == expunged {
+			return false
+		}
+		cv, ok := (*(*interface{})(p)).(*cacheValue)
+		if !ok || cv.v != old || (cv.expiresUnixNano != 0 && cv.expiresUnixNano <= time.Now().UnixNano()) {
+			return false
+		}
+		nv := interface{}(cs.wrap(new))
+		if atomic.CompareAndSwapPointer(&e.p, p, unsafe.Pointer(&nv)) {
+			return true
+		}
+	}
+}
+
+// tryCompareAndDeleteCached和tryCompareAndSwapCached同理，用于CompareAndDelete。
+func (e *entry) tryCompareAndDeleteCached(old interface{}) bool {
+	for {
+		p := atomic.LoadPointer(&e.p)
+		if p == nil || p == expunged {
+			return false
+		}
+		cv, ok := (*(*interface{})(p)).(*cacheValue)
+		if !ok || cv.v != old || (cv.expiresUnixNano != 0 && cv.expiresUnixNano <= time.Now().UnixNano()) {
+			return false
+		}
+		if atomic.CompareAndSwapPointer(&e.p, p, nil) {
+			return true
+		}
+	}
+}
+
+// janitor 周期性地清理缓存模式Map里过期/超限的entries，直到Close被调用。
+func (cs *cacheState) janitor(m *Map) {
+	ticker := time.NewTicker(cs.cfg.SweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-cs.stop:
+			return
+		case <-ticker.C:
+			m.cacheSweep()
+		}
+	}
+}
+
+// cacheSweep 做一轮过期扫描和（如果配置了MaxSize）CLOCK近似淘汰。借用
+// Range同款的dirty->read提升技巧，保证这一轮能扫到所有key，同时只在
+// 提升dirty的那一小段持有m.mu。
+func (m *Map) cacheSweep() {
+	cs := m.cache
+
+	m.mu.Lock()
+	read, _ := m.read.Load().(readOnly)
+	if read.amended {
+		read = readOnly{m: m.dirty}
+		m.read.Store(read)
+		m.dirty = nil
+		m.misses = 0
+	}
+	m.mu.Unlock()
+
+	type alive struct {
+		key interface{}
+		e   *entry
+		cv  *cacheValue
+	}
+	var candidates []alive
+	now := time.Now().UnixNano()
+
+	for k, e := range read.m {
+		p := atomic.LoadPointer(&e.p)
+		if p == nil || p == expunged {
+			continue
+		}
+		raw := *(*interface{})(p)
+		cv, ok := raw.(*cacheValue)
+		if !ok {
+			continue
+		}
+		if cv.expiresUnixNano != 0 && cv.expiresUnixNano <= now {
+			if _, deleted := e.loadAndDelete(); deleted && cs.cfg.OnEvict != nil {
+				cs.cfg.OnEvict(k, cv.v)
+			}
+			continue
+		}
+		candidates = append(candidates, alive{key: k, e: e, cv: cv})
+	}
+
+	if cs.cfg.MaxSize > 0 && len(candidates) > cs.cfg.MaxSize {
+		// 淘汰上一轮就没被访问过（recentlyUsed仍为0）的entries，直到
+		// 回到MaxSize以内；这是CLOCK算法的近似，不保证淘汰的一定是
+		// 最久未使用的那个。
+		excess := len(candidates) - cs.cfg.MaxSize
+		for _, c := range candidates {
+			if excess <= 0 {
+				break
+			}
+			if atomic.LoadInt32(&c.cv.recentlyUsed) != 0 {
+				continue
+			}
+			// 直接用entry自己的、不解包cacheValue的CAS：这里比较的是
+			// entry.p里那层cacheValue指针本身有没有变过，而不是用户看到
+			// 的value——和Map.CompareAndDelete暴露给外部调用者的"按用户
+			// 值比较"语义是两回事。
+			if c.e.tryCompareAndDelete(c.cv) {
+				excess--
+				if cs.cfg.OnEvict != nil {
+					cs.cfg.OnEvict(c.key, c.cv.v)
+				}
+			}
+		}
+	}
+
+	// 为下一轮的CLOCK扫描清零标记位；本轮期间被Load/Store碰过的
+	// entry已经在别处把标记重新置1了。
+	for _, c := range candidates {
+		atomic.StoreInt32(&c.cv.recentlyUsed, 0)
+	}
+}
@@ -0,0 +1,98 @@
+package sync
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestCacheTTLExpiry验证超过TTL的entry在Load时表现得像从未被Store过，
+// 并且OnEvict会被调用一次。
+func TestCacheTTLExpiry(t *testing.T) {
+	var evicted []interface{}
+	var mu sync.Mutex
+
+	m := NewMapWithCache(CacheConfig{
+		TTL: time.Millisecond,
+		OnEvict: func(key, value interface{}) {
+			mu.Lock()
+			evicted = append(evicted, key)
+			mu.Unlock()
+		},
+	})
+	defer m.Close()
+
+	m.Store("a", "hello")
+	time.Sleep(10 * time.Millisecond)
+
+	if _, ok := m.Load("a"); ok {
+		t.Fatalf("Load(a) should have expired")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(evicted) != 1 || evicted[0] != "a" {
+		t.Fatalf("OnEvict called with %v, want [a]", evicted)
+	}
+}
+
+// TestCacheMaxSizeEviction验证janitor会把超出MaxSize的、最近没被访问
+// 过的entries淘汰掉。注意淘汰是CLOCK近似算法：第一轮sweep只清零
+// recentlyUsed标记，真正的淘汰要等到第二轮，所以这里只在睡够若干个
+// SweepInterval之后才检查一次，中途不能碰这个map——Range/Load都会把
+// recentlyUsed重新标记为1，使淘汰永远追不上。
+func TestCacheMaxSizeEviction(t *testing.T) {
+	const sweepInterval = 5 * time.Millisecond
+	m := NewMapWithCache(CacheConfig{MaxSize: 2, SweepInterval: sweepInterval})
+	defer m.Close()
+
+	m.Store("a", 1)
+	m.Store("b", 2)
+	m.Store("c", 3)
+
+	time.Sleep(20 * sweepInterval)
+
+	count := 0
+	m.Range(func(k, v interface{}) bool {
+		count++
+		return true
+	})
+	if count > 2 {
+		t.Fatalf("janitor never brought the map back down to MaxSize, got %d entries", count)
+	}
+}
+
+// TestCacheJanitorRace并发地对一个缓存模式的Map做Store/Load/Delete，
+// 同时让janitor协程在后台跑，配合-race验证janitor和普通读写之间没有
+// 数据竞争。
+func TestCacheJanitorRace(t *testing.T) {
+	m := NewMapWithCache(CacheConfig{
+		TTL:           2 * time.Millisecond,
+		MaxSize:       4,
+		SweepInterval: time.Millisecond,
+	})
+	defer m.Close()
+
+	const goroutines = 16
+	const iterations = 200
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				key := (g + i) % 8
+				switch i % 3 {
+				case 0:
+					m.Store(key, i)
+				case 1:
+					m.Load(key)
+				case 2:
+					m.Delete(key)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
@@ -5,6 +5,7 @@
 package sync
 
 import (
+	"reflect"
 	"sync"
 	"sync/atomic"
 	"unsafe"
@@ -52,6 +53,16 @@ type Map struct {
 	// map， 并且下一个存储到map的操作，将生成一个新的
 	// dirty 副本。
 	misses int
+
+	// cache 非nil时，Map进入带TTL/LRU的缓存模式，由NewMapWithCache开启。
+	// 为nil时（默认的普通Map），Load/Store只多一次m.cache != nil的判断，
+	// 不走任何缓存相关的逻辑。
+	cache *cacheState
+
+	// stats 是Stats/SetObserver用到的运行时计数器和observer，字段本身
+	// 始终存在：计数器在Load/Store等分支上总是做一次atomic.Uint64自增，
+	// 和是否调用Stats无关；observer默认是nil，只在非nil时才会被调用。
+	stats mapStats
 }
 
 // readOnly is an immutable struct stored atomically in the Map.read field.
@@ -90,9 +101,14 @@ func (m *Map) Load(key interface{}) (value interface{}, ok bool) {
 	// 加载 read map，并检查是否 entry 存在。
 	read, _ := m.read.Load().(readOnly)
 	e, ok := read.m[key]
+	if ok {
+		m.stats.loadFastPath.Add(1)
+		m.stats.notify(MapEvent{Kind: EventLoadFastPath, Key: key})
+	}
 
 	// 如果key不存在，并且m.dirty里面有read没有的key，则进行多一次查找
 	if !ok && read.amended {
+		m.stats.loadSlowPath.Add(1)
 		m.mu.Lock()
 
 		// 这里又从新查了一次，因为怕在抢占锁之前，dirty刚被提升到到read。
@@ -110,7 +126,14 @@ func (m *Map) Load(key interface{}) (value interface{}, ok bool) {
 		return nil, false
 	}
 	// 加载entry里的数据
-	return e.load()
+	value, ok = e.load()
+	if !ok {
+		return nil, false
+	}
+	if m.cache != nil {
+		return m.unwrapCacheValue(key, e, value)
+	}
+	return value, true
 }
 
 // load entry 里的数据，如果数据的指针为nil或expunged，则
@@ -125,13 +148,19 @@ func (e *entry) load() (value interface{}, ok bool) {
 
 // Store 值到某个key
 func (m *Map) Store(key, value interface{}) {
+	if m.cache != nil {
+		value = m.cache.wrap(value)
+	}
 	// 加载read，如果值已经存在，直接尝试替换entry的里面的数据指针。
 	read, _ := m.read.Load().(readOnly)
 	if e, ok := read.m[key]; ok && e.tryStore(&value) {
+		m.stats.storeFastPath.Add(1)
+		m.stats.notify(MapEvent{Kind: EventStoreFastPath, Key: key})
 		return
 	}
 
 	// 加锁来处理
+	m.stats.storeSlowPath.Add(1)
 	m.mu.Lock()
 	read, _ = m.read.Load().(readOnly)
 
@@ -283,6 +312,237 @@ func (e *entry) delete() (hadValue bool) {
 	}
 }
 
+// LoadAndDelete 删除key关联的数据，并返回删除前的数据。loaded标识
+// key是否在删除之前存在于map里。
+func (m *Map) LoadAndDelete(key interface{}) (value interface{}, loaded bool) {
+	read, _ := m.read.Load().(readOnly)
+	e, ok := read.m[key]
+	if !ok && read.amended {
+		m.mu.Lock()
+		read, _ = m.read.Load().(readOnly)
+		e, ok = read.m[key]
+		if !ok && read.amended {
+			e, ok = m.dirty[key]
+			delete(m.dirty, key)
+			// 和Load一样记一次miss（Delete不记），即使这个key本身没有命中，
+			// 也算作一次miss，这样能推进dirty提升到read的进度。
+			m.missLocked()
+		}
+		m.mu.Unlock()
+	}
+	if !ok {
+		return nil, false
+	}
+	value, loaded = e.loadAndDelete()
+	if !loaded {
+		return nil, false
+	}
+	return m.unwrapPrevious(value)
+}
+
+// unwrapPrevious把entry.p里取出来的原始值，还原成调用方应该看到的
+// value。普通模式下原样返回；缓存模式下entry里存的是cacheState.wrap
+// 过的*cacheValue，需要解包，并且把已经过期的值当成未找到处理——用于
+// LoadAndDelete/Swap这类entry已经被整个摘下来的路径，这里不会、也不
+// 需要触发OnEvict（它只在janitor或Load/Range发现过期时触发）。
+func (m *Map) unwrapPrevious(raw interface{}) (value interface{}, ok bool) {
+	if m.cache == nil {
+		return raw, true
+	}
+	return m.cache.unwrap(raw)
+}
+
+// loadAndDelete 原子性的删除entry里的数据，并返回删除前的value。如果
+// entry已经是nil或expunged，返回(nil, false)。
+func (e *entry) loadAndDelete() (value interface{}, ok bool) {
+	for {
+		p := atomic.LoadPointer(&e.p)
+		if p == nil || p == expunged {
+			return nil, false
+		}
+		if atomic.CompareAndSwapPointer(&e.p, p, nil) {
+			return *(*interface{})(p), true
+		}
+	}
+}
+
+// Swap 无条件的替换key关联的value，并返回替换前的value。
+// previous为之前的value，loaded标识key在替换之前是否存在。
+func (m *Map) Swap(key, value interface{}) (previous interface{}, loaded bool) {
+	if m.cache != nil {
+		value = m.cache.wrap(value)
+	}
+	read, _ := m.read.Load().(readOnly)
+	if e, ok := read.m[key]; ok {
+		if v, ok := e.trySwap(&value); ok {
+			if v == nil {
+				return nil, false
+			}
+			return m.unwrapPrevious(*v)
+		}
+	}
+
+	m.mu.Lock()
+	read, _ = m.read.Load().(readOnly)
+	if e, ok := read.m[key]; ok {
+		if e.unexpungeLocked() {
+			// entry之前被标记删除，说明它已经不在dirty里了，重新添加进去。
+			m.dirty[key] = e
+		}
+		if v := e.swapLocked(&value); v != nil {
+			previous, loaded = m.unwrapPrevious(*v)
+		}
+	} else if e, ok := m.dirty[key]; ok {
+		if v := e.swapLocked(&value); v != nil {
+			previous, loaded = m.unwrapPrevious(*v)
+		}
+		m.missLocked()
+	} else {
+		if !read.amended {
+			m.dirtyLocked()
+			m.read.Store(readOnly{m: read.m, amended: true})
+		}
+		m.dirty[key] = newEntry(value)
+	}
+	m.mu.Unlock()
+	return previous, loaded
+}
+
+// trySwap 尝试原子性的替换entry里的值，前提是entry还没有被标记为expunged。
+func (e *entry) trySwap(i *interface{}) (*interface{}, bool) {
+	for {
+		p := atomic.LoadPointer(&e.p)
+		if p == expunged {
+			return nil, false
+		}
+		if atomic.CompareAndSwapPointer(&e.p, p, unsafe.Pointer(i)) {
+			return (*interface{})(p), true
+		}
+	}
+}
+
+// swapLocked 无条件的替换entry里的value并返回替换之前的指针，调用方
+// 必须持有m.mu，并且entry不能为expunged。
+func (e *entry) swapLocked(i *interface{}) *interface{} {
+	return (*interface{})(atomic.SwapPointer(&e.p, unsafe.Pointer(i)))
+}
+
+// isComparable 判断一个interface{}里装的值是否可以用==比较。nil本身
+// 永远可比较；slice/map/func这类类型不可比较，对它们用==会panic。
+func isComparable(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	return reflect.TypeOf(v).Comparable()
+}
+
+// CompareAndSwap 当且仅当key当前关联的value等于old时，把它替换为new，
+// 并返回是否替换成功。如果old是不可比较的类型（slice/map/func），
+// 直接返回false，而不是像普通interface{}之间用==比较那样panic。
+func (m *Map) CompareAndSwap(key, old, new interface{}) (swapped bool) {
+	if !isComparable(old) {
+		return false
+	}
+	read, _ := m.read.Load().(readOnly)
+	if e, ok := read.m[key]; ok {
+		return m.tryCompareAndSwapEntry(e, old, new)
+	} else if !read.amended {
+		// 不在read里，并且dirty和read内容一致，说明key根本不存在。
+		return false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	read, _ = m.read.Load().(readOnly)
+	swapped = false
+	if e, ok := read.m[key]; ok {
+		swapped = m.tryCompareAndSwapEntry(e, old, new)
+	} else if e, ok := m.dirty[key]; ok {
+		swapped = m.tryCompareAndSwapEntry(e, old, new)
+		// 即便没有换成功，也走到了dirty查找这条路径，按Load的约定记一次miss。
+		m.missLocked()
+	}
+	return swapped
+}
+
+// tryCompareAndSwapEntry根据Map是否处于缓存模式，选择对应的比较方式：
+// 普通模式下entry.p存的就是裸value，直接用==比较；缓存模式下entry.p
+// 存的是cacheState.wrap过的*cacheValue，需要先解包出真正的value再比较，
+// 并且新值也要重新wrap之后才能存回去。
+func (m *Map) tryCompareAndSwapEntry(e *entry, old, new interface{}) bool {
+	if m.cache != nil {
+		return e.tryCompareAndSwapCached(m.cache, old, new)
+	}
+	return e.tryCompareAndSwap(old, new)
+}
+
+// tryCompareAndSwap 原子性的比较entry里的值和old，如果相等则替换为new。
+// entry已经被标记为expunged，或者当前值和old不相等，都返回false。调用方
+// 必须保证old是可比较的类型（见isComparable），否则这里的==会panic。
+func (e *entry) tryCompareAndSwap(old, new interface{}) bool {
+	for {
+		p := atomic.LoadPointer(&e.p)
+		if p == nil || p == expunged || *(*interface{})(p) != old {
+			return false
+		}
+		nc := new
+		if atomic.CompareAndSwapPointer(&e.p, p, unsafe.Pointer(&nc)) {
+			return true
+		}
+	}
+}
+
+// CompareAndDelete 当且仅当key当前关联的value等于old时，删除这个key，
+// 并返回是否删除成功。如果key不存在，返回false。如果old是不可比较的
+// 类型（slice/map/func），同样直接返回false，而不是panic。
+func (m *Map) CompareAndDelete(key, old interface{}) (deleted bool) {
+	if !isComparable(old) {
+		return false
+	}
+	read, _ := m.read.Load().(readOnly)
+	e, ok := read.m[key]
+	if !ok && read.amended {
+		m.mu.Lock()
+		read, _ = m.read.Load().(readOnly)
+		e, ok = read.m[key]
+		if !ok && read.amended {
+			e, ok = m.dirty[key]
+			// 和Delete不同，这里不从dirty里删掉entry，交给entry自己的CAS去
+			// 处理：比较不相等时key必须留在map里。
+			m.missLocked()
+		}
+		m.mu.Unlock()
+	}
+	if !ok {
+		return false
+	}
+	return m.tryCompareAndDeleteEntry(e, old)
+}
+
+// tryCompareAndDeleteEntry和tryCompareAndSwapEntry同理，根据Map是否
+// 处于缓存模式选择对应的比较方式。
+func (m *Map) tryCompareAndDeleteEntry(e *entry, old interface{}) bool {
+	if m.cache != nil {
+		return e.tryCompareAndDeleteCached(old)
+	}
+	return e.tryCompareAndDelete(old)
+}
+
+// tryCompareAndDelete原子性的比较entry里的值和old，如果相等则删除。
+// entry已经被标记为expunged，或者当前值和old不相等，都返回false。调用方
+// 必须保证old是可比较的类型（见isComparable），否则这里的==会panic。
+func (e *entry) tryCompareAndDelete(old interface{}) bool {
+	for {
+		p := atomic.LoadPointer(&e.p)
+		if p == nil || p == expunged || *(*interface{})(p) != old {
+			return false
+		}
+		if atomic.CompareAndSwapPointer(&e.p, p, nil) {
+			return true
+		}
+	}
+}
+
 // Range calls f sequentially for each key and value present in the map.
 // If f returns false, range stops the iteration.
 //
@@ -311,6 +571,7 @@ func (m *Map) Range(f func(key, value interface{}) bool) {
 			m.read.Store(read)
 			m.dirty = nil
 			m.misses = 0
+			m.stats.promotions.Add(1)
 		}
 		m.mu.Unlock()
 	}
@@ -320,6 +581,12 @@ func (m *Map) Range(f func(key, value interface{}) bool) {
 		if !ok {
 			continue
 		}
+		if m.cache != nil {
+			v, ok = m.unwrapCacheValue(k, e, v)
+			if !ok {
+				continue
+			}
+		}
 		if !f(k, v) {
 			break
 		}
@@ -330,12 +597,14 @@ func (m *Map) Range(f func(key, value interface{}) bool) {
 // 则dirty提升为read，并dirty设置为nil, 清空misses。
 func (m *Map) missLocked() {
 	m.misses++
+	m.stats.misses.Add(1)
 	if m.misses < len(m.dirty) {
 		return
 	}
 	m.read.Store(readOnly{m: m.dirty})
 	m.dirty = nil
 	m.misses = 0
+	m.stats.promotions.Add(1)
 }
 
 // 如果dirty 未初始化，从read加载数据，并初始化真个dirty map
@@ -350,6 +619,8 @@ func (m *Map) dirtyLocked() {
 		// 如果还未被删除，则拷贝到dirty。
 		if !e.tryExpungeLocked() {
 			m.dirty[k] = e
+		} else {
+			m.stats.expunged.Add(1)
 		}
 	}
 }
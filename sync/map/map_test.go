@@ -0,0 +1,150 @@
+package sync
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestCompareAndSwapNonComparable 验证old是不可比较类型（slice/map/func）
+// 时CompareAndSwap/CompareAndDelete返回false，而不是像普通interface{}
+// 的==那样panic。
+func TestCompareAndSwapNonComparable(t *testing.T) {
+	var m Map
+	m.Store("k", []int{1, 2, 3})
+
+	if swapped := m.CompareAndSwap("k", []int{1, 2, 3}, []int{4, 5, 6}); swapped {
+		t.Fatalf("CompareAndSwap with a non-comparable old value should fail, got true")
+	}
+	if deleted := m.CompareAndDelete("k", []int{1, 2, 3}); deleted {
+		t.Fatalf("CompareAndDelete with a non-comparable old value should fail, got true")
+	}
+
+	// 原值必须保持不变。
+	v, ok := m.Load("k")
+	if !ok {
+		t.Fatalf("key disappeared after a failed CompareAndSwap/CompareAndDelete")
+	}
+	if got := v.([]int); len(got) != 3 || got[0] != 1 {
+		t.Fatalf("value changed after a failed CompareAndSwap: got %v", got)
+	}
+}
+
+// TestMapMutatorsRace 并发地对同一批key执行LoadAndDelete/Swap/
+// CompareAndSwap/CompareAndDelete/Store/Load，配合-race跑，检验这些新
+// 增的原子操作之间以及和原有Load/Store之间没有数据竞争。
+func TestMapMutatorsRace(t *testing.T) {
+	var m Map
+	const keys = 8
+	const goroutines = 16
+	const iterations = 200
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				key := (g + i) % keys
+				switch i % 6 {
+				case 0:
+					m.Store(key, i)
+				case 1:
+					m.Load(key)
+				case 2:
+					m.LoadAndDelete(key)
+				case 3:
+					m.Swap(key, i)
+				case 4:
+					m.CompareAndSwap(key, i, i+1)
+				case 5:
+					m.CompareAndDelete(key, i)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+// FuzzMapAgainstReference 用一个普通map+Mutex作为参照实现，重放fuzz给
+// 出的操作序列，校验Map在LoadAndDelete/Swap/CompareAndSwap/
+// CompareAndDelete上的行为和参照实现一致。
+func FuzzMapAgainstReference(f *testing.F) {
+	f.Add([]byte{0, 1, 2, 3, 4, 5, 1, 0, 2, 1})
+
+	f.Fuzz(func(t *testing.T, ops []byte) {
+		var m Map
+		ref := struct {
+			sync.Mutex
+			m map[int]int
+		}{m: make(map[int]int)}
+
+		const numKeys = 4
+		for i := 0; i < len(ops); i++ {
+			op := ops[i] % 6
+			key := int(ops[i]) % numKeys
+			val := i
+
+			switch op {
+			case 0:
+				m.Store(key, val)
+				ref.Lock()
+				ref.m[key] = val
+				ref.Unlock()
+			case 1:
+				got, gotOK := m.Load(key)
+				ref.Lock()
+				want, wantOK := ref.m[key]
+				ref.Unlock()
+				if gotOK != wantOK || (gotOK && got.(int) != want) {
+					t.Fatalf("Load(%d) = (%v, %v), want (%v, %v)", key, got, gotOK, want, wantOK)
+				}
+			case 2:
+				got, gotOK := m.LoadAndDelete(key)
+				ref.Lock()
+				want, wantOK := ref.m[key]
+				delete(ref.m, key)
+				ref.Unlock()
+				if gotOK != wantOK || (gotOK && got.(int) != want) {
+					t.Fatalf("LoadAndDelete(%d) = (%v, %v), want (%v, %v)", key, got, gotOK, want, wantOK)
+				}
+			case 3:
+				got, gotOK := m.Swap(key, val)
+				ref.Lock()
+				want, wantOK := ref.m[key]
+				ref.m[key] = val
+				ref.Unlock()
+				if gotOK != wantOK || (gotOK && got.(int) != want) {
+					t.Fatalf("Swap(%d) = (%v, %v), want (%v, %v)", key, got, gotOK, want, wantOK)
+				}
+			case 4:
+				ref.Lock()
+				cur, curOK := ref.m[key]
+				ref.Unlock()
+				swapped := m.CompareAndSwap(key, cur, val)
+				ref.Lock()
+				wantSwapped := curOK && ref.m[key] == cur
+				if wantSwapped {
+					ref.m[key] = val
+				}
+				ref.Unlock()
+				if swapped != wantSwapped {
+					t.Fatalf("CompareAndSwap(%d, %d, %d) = %v, want %v", key, cur, val, swapped, wantSwapped)
+				}
+			case 5:
+				ref.Lock()
+				cur, curOK := ref.m[key]
+				ref.Unlock()
+				deleted := m.CompareAndDelete(key, cur)
+				ref.Lock()
+				wantDeleted := curOK && ref.m[key] == cur
+				if wantDeleted {
+					delete(ref.m, key)
+				}
+				ref.Unlock()
+				if deleted != wantDeleted {
+					t.Fatalf("CompareAndDelete(%d, %d) = %v, want %v", key, cur, deleted, wantDeleted)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,309 @@
+package sync
+
+import (
+	"math"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// defaultShardCount 是 ShardedMap 在未指定分片数时使用的默认值，
+// 对应 Java ConcurrentHashMap 的默认并发级别思路：用分片把锁的粒度
+// 从整个map收窄到一个分片，以降低写多场景下的锁竞争。
+const defaultShardCount = 32
+
+// mapShard 是 ShardedMap 的一个分片，拥有独立的读写锁，只保护
+// 这一个分片内的 entries，互不影响其他分片的读写。
+type mapShard struct {
+	mu sync.RWMutex
+	m  map[interface{}]*entry
+
+	// count 是该分片当前存活（未删除）的 key 数量，原子维护，
+	// 这样 ShardedMap.Len 不需要遍历所有分片加锁求和。
+	count int64
+}
+
+// ShardedMap 是 Map 的一个替代实现，把 key 按哈希分散到固定数量的
+// 分片（shard）里，每个分片只用自己的锁保护自己的那一小块数据。
+//
+// Map 针对的是读多写少或者各协程访问不相交 key 集合的场景；当写操作
+// 频繁且不同协程之间频繁竞争同一批 key 时，Map 的 read/dirty 提升
+// 机制反而会带来额外开销。ShardedMap 用固定数量的锁把竞争打散到
+// 各个分片，更适合这种写多场景。
+//
+// ShardedMap 的零值不可用，必须通过 NewShardedMap 创建。
+type ShardedMap struct {
+	shards []*mapShard
+	mask   uint64
+}
+
+// NewShardedMap 创建一个 ShardedMap。shardCount 指定分片数量，会被
+// 向上取整到最近的 2 的幂，以便用位运算 `hash & mask` 代替取模来选
+// 分片。shardCount <= 0 时使用 defaultShardCount。
+func NewShardedMap(shardCount int) *ShardedMap {
+	if shardCount <= 0 {
+		shardCount = defaultShardCount
+	}
+	n := nextPowerOfTwo(uint64(shardCount))
+
+	shards := make([]*mapShard, n)
+	for i := range shards {
+		shards[i] = &mapShard{m: make(map[interface{}]*entry)}
+	}
+	return &ShardedMap{shards: shards, mask: n - 1}
+}
+
+// nextPowerOfTwo 返回大于等于 n 的最小的 2 的幂，n < 1 时返回 1。
+func nextPowerOfTwo(n uint64) uint64 {
+	if n < 1 {
+		return 1
+	}
+	n--
+	n |= n >> 1
+	n |= n >> 2
+	n |= n >> 4
+	n |= n >> 8
+	n |= n >> 16
+	n |= n >> 32
+	return n + 1
+}
+
+// shardFor 用 key 的哈希值选出对应的分片，mask 是 2 的幂减一，
+// 用 `&` 代替 `%` 来加速定位。
+func (sm *ShardedMap) shardFor(key interface{}) *mapShard {
+	h := hashKey(key)
+	return sm.shards[h&sm.mask]
+}
+
+// FNV-1a 的 64 位偏移基和质数，用于下面几个 hash 函数。
+const (
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+// fnvMixUint64 把一个 uint64 按字节混入 FNV-1a 累加器。
+func fnvMixUint64(h uint64, v uint64) uint64 {
+	for i := 0; i < 8; i++ {
+		h ^= v & 0xff
+		h *= fnvPrime64
+		v >>= 8
+	}
+	return h
+}
+
+// fnvMixString 把一个字符串的内容按字节混入 FNV-1a 累加器。
+func fnvMixString(h uint64, s string) uint64 {
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= fnvPrime64
+	}
+	return h
+}
+
+// fnvString 对字符串内容做 FNV-1a 哈希。
+func fnvString(s string) uint64 {
+	return fnvMixString(fnvOffset64, s)
+}
+
+// hashKey 计算 key 的哈希值，用于选择分片。对 string/int/int64/uint64
+// 这几种最常见的 key 类型做特化处理，按内容哈希，避免反射开销；其他
+// 类型统一走 hashReflectValue，按 key 的实际值（而不是它被装箱到
+// interface{} 里用的类型指针/数据指针）递归做哈希 —— 两个 == 相等
+// 但分别装箱的 key（比如两次分别 new 出来的相同 struct）必须落到
+// 同一个分片，否则会出现"明明 Store 过却 Load 不到"的问题。
+func hashKey(key interface{}) uint64 {
+	switch v := key.(type) {
+	case string:
+		return fnvString(v)
+	case int:
+		return fnvMixUint64(fnvOffset64, uint64(v))
+	case int64:
+		return fnvMixUint64(fnvOffset64, uint64(v))
+	case uint64:
+		return fnvMixUint64(fnvOffset64, v)
+	default:
+		return hashReflectValue(fnvOffset64, reflect.ValueOf(key))
+	}
+}
+
+// hashReflectValue 递归地把 v 的实际值（而非它的装箱地址）混入 h。
+// 覆盖的是 comparable 类型允许出现的所有 Kind：布尔、各种宽度的整数/
+// 浮点/复数、字符串、指针/channel/unsafe.Pointer（这几种本身就是按
+// 地址比较的，哈希地址是对的）、数组和结构体（逐个字段递归）。
+// Field/Index/Bool/Int/Uint/Float/Complex/String 这些按 Kind 取值的
+// 方法对未导出字段同样有效，不需要 Interface()，所以这里不会因为
+// 结构体里有未导出字段而 panic。
+func hashReflectValue(h uint64, v reflect.Value) uint64 {
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return fnvMixUint64(h, 1)
+		}
+		return fnvMixUint64(h, 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return fnvMixUint64(h, uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return fnvMixUint64(h, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return fnvMixUint64(h, floatKeyBits(v.Float()))
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		h = fnvMixUint64(h, floatKeyBits(real(c)))
+		return fnvMixUint64(h, floatKeyBits(imag(c)))
+	case reflect.String:
+		return fnvMixString(h, v.String())
+	case reflect.Pointer, reflect.Chan, reflect.UnsafePointer:
+		// 这些类型本身就是按地址比较 ==，所以按地址哈希是正确的。
+		return fnvMixUint64(h, uint64(v.Pointer()))
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			h = hashReflectValue(h, v.Index(i))
+		}
+		return h
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			h = hashReflectValue(h, v.Field(i))
+		}
+		return h
+	case reflect.Interface:
+		if v.IsNil() {
+			return fnvMixUint64(h, 0)
+		}
+		return hashReflectValue(h, v.Elem())
+	default:
+		// slice/map/func 这些不可比较的类型本来就不能作为 map 的 key，
+		// 正常情况下不会走到这里；保底返回固定值而不是 panic。
+		return h
+	}
+}
+
+// floatKeyBits 返回 f 用于哈希的位模式。-0.0 == +0.0，但两者的
+// Float64bits 不同，所以先统一成 +0.0，保证 == 相等的 key 哈希相同。
+func floatKeyBits(f float64) uint64 {
+	if f == 0 {
+		f = 0
+	}
+	return math.Float64bits(f)
+}
+
+// Load 返回 key 关联的 value，ok 标识是否找到。
+func (sm *ShardedMap) Load(key interface{}) (value interface{}, ok bool) {
+	s := sm.shardFor(key)
+	s.mu.RLock()
+	e, found := s.m[key]
+	s.mu.RUnlock()
+	if !found {
+		return nil, false
+	}
+	return e.load()
+}
+
+// Store 设置 key 关联的 value。
+func (sm *ShardedMap) Store(key, value interface{}) {
+	s := sm.shardFor(key)
+
+	s.mu.RLock()
+	if e, found := s.m[key]; found && e.tryStore(&value) {
+		s.mu.RUnlock()
+		return
+	}
+	s.mu.RUnlock()
+
+	s.mu.Lock()
+	if e, found := s.m[key]; found {
+		e.storeLocked(&value)
+	} else {
+		s.m[key] = newEntry(value)
+		atomic.AddInt64(&s.count, 1)
+	}
+	s.mu.Unlock()
+}
+
+// LoadOrStore 如果 key 已存在则返回已有 value，否则存入 value 并返回它。
+// loaded 为 true 表示命中已有值，为 false 表示本次发生了存储。
+func (sm *ShardedMap) LoadOrStore(key, value interface{}) (actual interface{}, loaded bool) {
+	s := sm.shardFor(key)
+
+	s.mu.RLock()
+	if e, found := s.m[key]; found {
+		if v, ok := e.load(); ok {
+			s.mu.RUnlock()
+			return v, true
+		}
+	}
+	s.mu.RUnlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, found := s.m[key]; found {
+		if v, ok := e.load(); ok {
+			return v, true
+		}
+		e.storeLocked(&value)
+		return value, false
+	}
+	s.m[key] = newEntry(value)
+	atomic.AddInt64(&s.count, 1)
+	return value, false
+}
+
+// LoadAndDelete 删除 key 并返回删除前的 value，loaded 标识 key 是否存在。
+func (sm *ShardedMap) LoadAndDelete(key interface{}) (value interface{}, loaded bool) {
+	s := sm.shardFor(key)
+
+	s.mu.Lock()
+	e, found := s.m[key]
+	if found {
+		delete(s.m, key)
+	}
+	s.mu.Unlock()
+
+	if !found {
+		return nil, false
+	}
+	v, ok := e.load()
+	if ok {
+		atomic.AddInt64(&s.count, -1)
+	}
+	return v, ok
+}
+
+// Delete 删除 key 关联的数据。
+func (sm *ShardedMap) Delete(key interface{}) {
+	sm.LoadAndDelete(key)
+}
+
+// Len 返回当前存活的 key 数量，通过原子读取各分片的 count 累加得到，
+// 代价是 O(分片数)，而不是 O(N)，这是 Map 无法廉价提供的能力。
+func (sm *ShardedMap) Len() int {
+	var total int64
+	for _, s := range sm.shards {
+		total += atomic.LoadInt64(&s.count)
+	}
+	return int(total)
+}
+
+// Range 按分片遍历所有 key/value，每次只持有一个分片的读锁，不对
+// 整个 ShardedMap 加锁。和 Map.Range 一样，只提供弱一致性保证：
+// 遍历期间某个 key 被并发存储或删除，Range 可能看到其任意一个时间点
+// 上的值，也可能看不到。f 返回 false 时停止遍历。
+func (sm *ShardedMap) Range(f func(key, value interface{}) bool) {
+	for _, s := range sm.shards {
+		s.mu.RLock()
+		snapshot := make(map[interface{}]*entry, len(s.m))
+		for k, e := range s.m {
+			snapshot[k] = e
+		}
+		s.mu.RUnlock()
+
+		for k, e := range snapshot {
+			v, ok := e.load()
+			if !ok {
+				continue
+			}
+			if !f(k, v) {
+				return
+			}
+		}
+	}
+}
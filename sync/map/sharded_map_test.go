@@ -0,0 +1,111 @@
+package sync
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestShardedMapBasic覆盖ShardedMap最基本的读写语义：Store/Load/
+// LoadOrStore/LoadAndDelete/Delete/Len。
+func TestShardedMapBasic(t *testing.T) {
+	sm := NewShardedMap(4)
+
+	sm.Store("a", 1)
+	if v, ok := sm.Load("a"); !ok || v.(int) != 1 {
+		t.Fatalf("Load(a) = (%v, %v), want (1, true)", v, ok)
+	}
+
+	if actual, loaded := sm.LoadOrStore("a", 2); !loaded || actual.(int) != 1 {
+		t.Fatalf("LoadOrStore(a) existing = (%v, %v), want (1, true)", actual, loaded)
+	}
+	if actual, loaded := sm.LoadOrStore("b", 2); loaded || actual.(int) != 2 {
+		t.Fatalf("LoadOrStore(b) new = (%v, %v), want (2, false)", actual, loaded)
+	}
+
+	if sm.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", sm.Len())
+	}
+
+	if v, loaded := sm.LoadAndDelete("a"); !loaded || v.(int) != 1 {
+		t.Fatalf("LoadAndDelete(a) = (%v, %v), want (1, true)", v, loaded)
+	}
+	if _, ok := sm.Load("a"); ok {
+		t.Fatalf("a should be gone after LoadAndDelete")
+	}
+
+	sm.Delete("b")
+	if sm.Len() != 0 {
+		t.Fatalf("Len() after deleting everything = %d, want 0", sm.Len())
+	}
+}
+
+// TestShardedMapHashesByValue是对hashKey从"按装箱地址哈希"改成"按值
+// 哈希"这个修复的回归测试：两把分别装箱、但==相等的struct/float64 key，
+// 必须落到同一个分片，Store之后用一个新分配的相同key依然能Load到。
+func TestShardedMapHashesByValue(t *testing.T) {
+	type Key struct{ A, B int }
+	sm := NewShardedMap(8)
+
+	sm.Store(Key{1, 2}, "hello")
+	if v, ok := sm.Load(Key{1, 2}); !ok || v.(string) != "hello" {
+		t.Fatalf("Load(Key{1,2}) = (%v, %v), want (hello, true)", v, ok)
+	}
+
+	f := 3.14
+	sm.Store(f, "pi")
+	if v, ok := sm.Load(3.14); !ok || v.(string) != "pi" {
+		t.Fatalf("Load(3.14) = (%v, %v), want (pi, true)", v, ok)
+	}
+}
+
+// TestShardedMapRange验证Range能访问到所有分片里的key/value。
+func TestShardedMapRange(t *testing.T) {
+	sm := NewShardedMap(4)
+	want := map[interface{}]interface{}{"a": 1, "b": 2, "c": 3}
+	for k, v := range want {
+		sm.Store(k, v)
+	}
+
+	got := make(map[interface{}]interface{})
+	sm.Range(func(k, v interface{}) bool {
+		got[k] = v
+		return true
+	})
+
+	if len(got) != len(want) {
+		t.Fatalf("Range visited %d entries, want %d", len(got), len(want))
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Fatalf("Range missed or mismatched %v: got %v, want %v", k, got[k], v)
+		}
+	}
+}
+
+// TestShardedMapConcurrent并发地对多个key执行Store/Load/Delete，配合
+// -race跑，检验各分片自己的锁之间没有数据竞争。
+func TestShardedMapConcurrent(t *testing.T) {
+	sm := NewShardedMap(8)
+	const goroutines = 16
+	const iterations = 200
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				key := (g + i) % 8
+				switch i % 3 {
+				case 0:
+					sm.Store(key, i)
+				case 1:
+					sm.Load(key)
+				case 2:
+					sm.LoadAndDelete(key)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,63 @@
+package sync
+
+// Snapshot 返回Map在某一时刻的一致性快照。和Range不同，Range只保证
+// 弱一致性（"does not necessarily correspond to any consistent
+// snapshot"），Snapshot用于备份、复制、调试这类需要一个确定的key集合
+// 的场景。
+//
+// 实现上复用了Range里dirty提升为read的技巧：持有m.mu把dirty提升为
+// read（如果有amended的话），这一步之后，任何新的Store都只会去改
+// dirty（一份新的拷贝），不会就地修改这份刚提升出来的read.m，所以
+// 释放mu之后继续遍历read.m，看到的key集合依然是不变的——只有某个
+// entry的value可能在遍历期间被并发修改或删除，这一点通过遍历时对
+// 每个entry只load一次来定格。
+func (m *Map) Snapshot() map[interface{}]interface{} {
+	m.mu.Lock()
+	read, _ := m.read.Load().(readOnly)
+	if read.amended {
+		read = readOnly{m: m.dirty}
+		m.read.Store(read)
+		m.dirty = nil
+		m.misses = 0
+		m.stats.promotions.Add(1)
+	}
+	m.mu.Unlock()
+
+	out := make(map[interface{}]interface{}, len(read.m))
+	for k, e := range read.m {
+		v, ok := e.load()
+		if !ok {
+			continue
+		}
+		if m.cache != nil {
+			v, ok = m.unwrapCacheValue(k, e, v)
+			if !ok {
+				continue
+			}
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// Clone 返回一个独立的Map，初始内容是调用时刻的Snapshot。返回的Map
+// 和原Map没有任何共享状态，对其中一个的后续读写不会影响另一个。
+//
+// 如果原Map是NewMapWithCache创建的缓存模式Map，克隆出来的Map会带着
+// 同样的CacheConfig（包括启动一个新的janitor协程，调用方用完后同样
+// 需要Close它），而不是退化成一个不过期、不限容量的普通Map。但由于
+// Snapshot返回的是已经拆箱的原始value，clone.Store会按它自己的TTL
+// 重新计时——也就是说clone里各entry的过期时间是从克隆时刻重新起算的，
+// 不是原entry剩余的TTL。
+func (m *Map) Clone() *Map {
+	var clone *Map
+	if m.cache != nil {
+		clone = NewMapWithCache(m.cache.cfg)
+	} else {
+		clone = &Map{}
+	}
+	for k, v := range m.Snapshot() {
+		clone.Store(k, v)
+	}
+	return clone
+}
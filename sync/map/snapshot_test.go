@@ -0,0 +1,56 @@
+package sync
+
+import (
+	"testing"
+	"time"
+)
+
+// TestSnapshotAndClone验证Snapshot返回调用时刻的完整key/value集合，
+// Clone返回的Map和原Map完全独立，互不影响。
+func TestSnapshotAndClone(t *testing.T) {
+	var m Map
+	m.Store("a", 1)
+	m.Store("b", 2)
+
+	snap := m.Snapshot()
+	if len(snap) != 2 || snap["a"] != 1 || snap["b"] != 2 {
+		t.Fatalf("Snapshot() = %v, want map[a:1 b:2]", snap)
+	}
+
+	clone := m.Clone()
+	m.Store("a", 100)
+	m.Delete("b")
+
+	if v, ok := clone.Load("a"); !ok || v.(int) != 1 {
+		t.Fatalf("clone[a] = (%v, %v), want (1, true); clone should not see later writes to m", v, ok)
+	}
+	if v, ok := clone.Load("b"); !ok || v.(int) != 2 {
+		t.Fatalf("clone[b] = (%v, %v), want (2, true); clone should not see later deletes from m", v, ok)
+	}
+
+	clone.Store("c", 3)
+	if _, ok := m.Load("c"); ok {
+		t.Fatalf("writes to clone should not be visible on m")
+	}
+}
+
+// TestCloneCacheConfig验证对NewMapWithCache创建的Map调用Clone，克隆出来
+// 的Map同样带着原来的TTL/MaxSize配置，而不是退化成普通Map。
+func TestCloneCacheConfig(t *testing.T) {
+	m := NewMapWithCache(CacheConfig{TTL: time.Hour, MaxSize: 10})
+	defer m.Close()
+	m.Store("a", 1)
+
+	clone := m.Clone()
+	defer clone.Close()
+
+	if clone.cache == nil {
+		t.Fatalf("Clone() of a cache-mode Map should also be cache-mode")
+	}
+	if clone.cache.cfg.TTL != time.Hour || clone.cache.cfg.MaxSize != 10 {
+		t.Fatalf("clone cache config = %+v, want TTL=1h MaxSize=10", clone.cache.cfg)
+	}
+	if v, ok := clone.Load("a"); !ok || v.(int) != 1 {
+		t.Fatalf("clone[a] = (%v, %v), want (1, true)", v, ok)
+	}
+}
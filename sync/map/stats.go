@@ -0,0 +1,96 @@
+package sync
+
+import "sync/atomic"
+
+// mapStats 是Map内部维护的运行时计数器和可选observer，嵌在Map里。
+// 零值即可用：计数器从0开始，observer为nil时notify是一个空操作。
+type mapStats struct {
+	loadFastPath  atomic.Uint64
+	loadSlowPath  atomic.Uint64
+	storeFastPath atomic.Uint64
+	storeSlowPath atomic.Uint64
+	misses        atomic.Uint64
+	promotions    atomic.Uint64
+	expunged      atomic.Uint64
+
+	observer atomic.Value // 存的是 func(MapEvent)
+}
+
+// MapStats 是Stats()返回的一份运行时计数快照，用来判断一个workload
+// 是否真的吃到了read/dirty分离带来的好处，还是应该干脆用普通map+锁。
+type MapStats struct {
+	ReadLen       int
+	DirtyLen      int
+	Misses        uint64
+	Promotions    uint64
+	ExpungedCount uint64
+	StoreFastPath uint64
+	StoreSlowPath uint64
+	LoadFastPath  uint64
+	LoadSlowPath  uint64
+}
+
+// MapEventKind 标识一次MapEvent对应Map内部的哪个分支。
+type MapEventKind int
+
+const (
+	// EventLoadFastPath 是Load命中read map、无需加锁时触发的事件。
+	EventLoadFastPath MapEventKind = iota
+	// EventStoreFastPath 是Store命中read map里已有entry、无需加锁时触发的事件。
+	EventStoreFastPath
+)
+
+// MapEvent 是传给SetObserver注册的回调的单次事件。
+type MapEvent struct {
+	Kind MapEventKind
+	Key  interface{}
+}
+
+// Stats 返回Map当前的运行时计数快照。ReadLen/DirtyLen需要读取read/dirty
+// 当前的大小，其余字段都是从counters里原子读取的。
+func (m *Map) Stats() MapStats {
+	read, _ := m.read.Load().(readOnly)
+
+	m.mu.Lock()
+	dirtyLen := len(m.dirty)
+	m.mu.Unlock()
+
+	return MapStats{
+		ReadLen:       len(read.m),
+		DirtyLen:      dirtyLen,
+		Misses:        m.stats.misses.Load(),
+		Promotions:    m.stats.promotions.Load(),
+		ExpungedCount: m.stats.expunged.Load(),
+		StoreFastPath: m.stats.storeFastPath.Load(),
+		StoreSlowPath: m.stats.storeSlowPath.Load(),
+		LoadFastPath:  m.stats.loadFastPath.Load(),
+		LoadSlowPath:  m.stats.loadSlowPath.Load(),
+	}
+}
+
+// SetObserver 注册一个回调，在Load/Store命中快速路径时被调用，方便
+// 接入Prometheus/OpenTelemetry之类的外部系统。传nil可以取消订阅。
+//
+// 快速路径上只做一次atomic.Value.Load来判断observer是否为nil，所以
+// 不设置observer时开销为零；设置了之后，回调本身的耗时会直接计入
+// Load/Store的调用方，调用方要自己保证回调足够轻量。
+func (m *Map) SetObserver(f func(event MapEvent)) {
+	if f == nil {
+		m.stats.observer.Store((func(MapEvent))(nil))
+		return
+	}
+	m.stats.observer.Store(f)
+}
+
+// notify 在非nil时把事件转发给已注册的observer。
+func (ms *mapStats) notify(evt MapEvent) {
+	v := ms.observer.Load()
+	if v == nil {
+		return
+	}
+	f, _ := v.(func(MapEvent))
+	if f == nil {
+		return
+	}
+	f(evt)
+}
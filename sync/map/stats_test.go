@@ -0,0 +1,68 @@
+package sync
+
+import "testing"
+
+// TestStatsFastAndSlowPath验证Stats()在Load/Store走快路径和慢路径时
+// 分别计数，并且ReadLen/DirtyLen反映实际的read/dirty大小。
+func TestStatsFastAndSlowPath(t *testing.T) {
+	var m Map
+
+	// 第一次Store命中不了read里的已有entry，走慢路径，只会进到dirty里。
+	m.Store("a", 1)
+	if got := m.Stats().StoreSlowPath; got != 1 {
+		t.Fatalf("StoreSlowPath after first Store = %d, want 1", got)
+	}
+
+	// Load一次触发miss计数，miss数追上dirty大小后把dirty提升为read。
+	m.Load("a")
+
+	// 再次Store同一个key，这次read里已经有entry了，走快路径。
+	m.Store("a", 2)
+	if got := m.Stats().StoreFastPath; got != 1 {
+		t.Fatalf("StoreFastPath after second Store = %d, want 1", got)
+	}
+
+	if v, ok := m.Load("a"); !ok || v.(int) != 2 {
+		t.Fatalf("Load(a) = (%v, %v), want (2, true)", v, ok)
+	}
+	if got := m.Stats().LoadFastPath; got != 1 {
+		t.Fatalf("LoadFastPath = %d, want 1", got)
+	}
+
+	stats := m.Stats()
+	if stats.ReadLen != 1 {
+		t.Fatalf("ReadLen = %d, want 1", stats.ReadLen)
+	}
+}
+
+// TestSetObserver验证注册的回调能收到快速路径事件，取消订阅（传nil）
+// 之后不再被调用。
+func TestSetObserver(t *testing.T) {
+	var m Map
+	m.Store("a", 1) // 先走一次慢路径把entry放进dirty。
+	m.Load("a")     // 触发miss计数，把dirty提升为read。
+
+	var events []MapEvent
+	m.SetObserver(func(evt MapEvent) {
+		events = append(events, evt)
+	})
+
+	m.Store("a", 2) // 命中快速路径，应该触发EventStoreFastPath。
+	m.Load("a")     // 命中快速路径，应该触发EventLoadFastPath。
+
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2: %+v", len(events), events)
+	}
+	if events[0].Kind != EventStoreFastPath || events[0].Key != "a" {
+		t.Fatalf("events[0] = %+v, want {EventStoreFastPath, a}", events[0])
+	}
+	if events[1].Kind != EventLoadFastPath || events[1].Key != "a" {
+		t.Fatalf("events[1] = %+v, want {EventLoadFastPath, a}", events[1])
+	}
+
+	m.SetObserver(nil)
+	m.Load("a")
+	if len(events) != 2 {
+		t.Fatalf("observer still firing after SetObserver(nil): %+v", events)
+	}
+}
@@ -0,0 +1,392 @@
+package sync
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// typedReadOnly 是 TypedMap.read 字段里原子存储的不可变结构体，和
+// Map的readOnly是同一个思路，只是key/value换成了泛型的K/V。
+type typedReadOnly[K comparable, V any] struct {
+	m       map[K]*typedEntry[V]
+	amended bool
+}
+
+// typedEntry 是TypedMap里一个key对应的槽。和Map的entry不同，p直接指
+// 向一份V（也就是*V本身被当成unsafe.Pointer存着），中间不再经过
+// interface{}这一层装箱：Map.Store(key, value)会把value拷贝进一个新
+// 分配的*interface{}（一次分配，外加interface本身的类型字/数据字开
+// 销）；typedEntry.p就是原始的*V，少了interface{}这一层间接和其类型
+// 信息开销。
+//
+// nil/expunged两种状态和Map的entry.p完全一致，复用的是包级别的同一个
+// expunged哨兵指针（它只是个不会和任何*V相等的任意地址，和指向的是
+// interface{}还是V无关）。
+type typedEntry[V any] struct {
+	p unsafe.Pointer // *V
+}
+
+// newTypedEntry 创建一个装着v的typedEntry。
+func newTypedEntry[V any](v V) *typedEntry[V] {
+	return &typedEntry[V]{p: unsafe.Pointer(&v)}
+}
+
+// load 读取entry里的值，entry被删除（nil或expunged）时返回零值和false。
+func (e *typedEntry[V]) load() (value V, ok bool) {
+	p := atomic.LoadPointer(&e.p)
+	if p == nil || p == expunged {
+		var zero V
+		return zero, false
+	}
+	return *(*V)(p), true
+}
+
+// tryStore 尝试原子替换entry里的值，entry已经expunged时返回false。
+func (e *typedEntry[V]) tryStore(v *V) bool {
+	for {
+		p := atomic.LoadPointer(&e.p)
+		if p == expunged {
+			return false
+		}
+		if atomic.CompareAndSwapPointer(&e.p, p, unsafe.Pointer(v)) {
+			return true
+		}
+	}
+}
+
+// unexpungeLocked 把entry从expunged状态恢复成nil，调用方必须持有mu，
+// 并且之后立刻把entry加回dirty。
+func (e *typedEntry[V]) unexpungeLocked() (wasExpunged bool) {
+	return atomic.CompareAndSwapPointer(&e.p, expunged, nil)
+}
+
+// storeLocked 无条件保存值到entry，调用方必须持有mu且entry不能是
+// expunged。
+func (e *typedEntry[V]) storeLocked(v *V) {
+	atomic.StorePointer(&e.p, unsafe.Pointer(v))
+}
+
+// tryExpungeLocked 检查entry是否已经被删除（p==nil），是的话尝试原子
+// 标记成expunged。调用方必须持有mu。
+func (e *typedEntry[V]) tryExpungeLocked() (isExpunged bool) {
+	p := atomic.LoadPointer(&e.p)
+	for p == nil {
+		if atomic.CompareAndSwapPointer(&e.p, nil, expunged) {
+			return true
+		}
+		p = atomic.LoadPointer(&e.p)
+	}
+	return p == expunged
+}
+
+// TypedMap 是 Map 的一个泛型替代实现，把 key/value 的类型从
+// interface{} 收窄为 K/V，弥补 Map 原生接口在类型安全上的短板：用 Map
+// 时，任何类型的值都能塞进同一个 key，拼写错误的类型断言只能在运行时
+// 发现。
+//
+// TypedMap 不是对Map的简单包装：它自己实现了和Map一样的read/dirty双
+// map协议（见Map的注释），只是entry.p里存的是裸的*V，不经过
+// interface{}装箱，所以对常见的 string -> *MyStruct 这类workload，
+// Store/Load不会多一次interface{}的分配和类型断言。
+//
+// TypedMap的零值可用，和Map一样使用之后不能被拷贝。
+type TypedMap[K comparable, V any] struct {
+	mu     sync.Mutex
+	read   atomic.Value // 这是个 typedReadOnly[K, V]
+	dirty  map[K]*typedEntry[V]
+	misses int
+}
+
+// Load 返回key关联的value，ok标识是否找到。
+func (tm *TypedMap[K, V]) Load(key K) (value V, ok bool) {
+	read, _ := tm.read.Load().(typedReadOnly[K, V])
+	e, ok := read.m[key]
+	if !ok && read.amended {
+		tm.mu.Lock()
+		read, _ = tm.read.Load().(typedReadOnly[K, V])
+		e, ok = read.m[key]
+		if !ok && read.amended {
+			e, ok = tm.dirty[key]
+			tm.missLocked()
+		}
+		tm.mu.Unlock()
+	}
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	return e.load()
+}
+
+// Store 设置key关联的value。
+func (tm *TypedMap[K, V]) Store(key K, value V) {
+	read, _ := tm.read.Load().(typedReadOnly[K, V])
+	if e, ok := read.m[key]; ok && e.tryStore(&value) {
+		return
+	}
+
+	tm.mu.Lock()
+	read, _ = tm.read.Load().(typedReadOnly[K, V])
+	if e, ok := read.m[key]; ok {
+		if e.unexpungeLocked() {
+			tm.dirty[key] = e
+		}
+		e.storeLocked(&value)
+	} else if e, ok := tm.dirty[key]; ok {
+		e.storeLocked(&value)
+	} else {
+		if !read.amended {
+			tm.dirtyLocked()
+			tm.read.Store(typedReadOnly[K, V]{m: read.m, amended: true})
+		}
+		tm.dirty[key] = newTypedEntry(value)
+	}
+	tm.mu.Unlock()
+}
+
+// LoadOrStore 如果key已存在则返回已有value，否则存入value并返回它。
+func (tm *TypedMap[K, V]) LoadOrStore(key K, value V) (actual V, loaded bool) {
+	read, _ := tm.read.Load().(typedReadOnly[K, V])
+	if e, ok := read.m[key]; ok {
+		if v, ok := e.load(); ok {
+			return v, true
+		}
+	}
+
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	read, _ = tm.read.Load().(typedReadOnly[K, V])
+	if e, ok := read.m[key]; ok {
+		if e.unexpungeLocked() {
+			tm.dirty[key] = e
+		}
+		if v, ok := e.load(); ok {
+			return v, true
+		}
+		e.storeLocked(&value)
+		return value, false
+	}
+	if e, ok := tm.dirty[key]; ok {
+		if v, ok := e.load(); ok {
+			tm.missLocked()
+			return v, true
+		}
+		e.storeLocked(&value)
+		tm.missLocked()
+		return value, false
+	}
+	if !read.amended {
+		tm.dirtyLocked()
+		tm.read.Store(typedReadOnly[K, V]{m: read.m, amended: true})
+	}
+	tm.dirty[key] = newTypedEntry(value)
+	return value, false
+}
+
+// LoadAndDelete 删除key并返回删除前的value，loaded标识key是否存在。
+func (tm *TypedMap[K, V]) LoadAndDelete(key K) (value V, loaded bool) {
+	read, _ := tm.read.Load().(typedReadOnly[K, V])
+	e, ok := read.m[key]
+	if !ok && read.amended {
+		tm.mu.Lock()
+		read, _ = tm.read.Load().(typedReadOnly[K, V])
+		e, ok = read.m[key]
+		if !ok && read.amended {
+			e, ok = tm.dirty[key]
+			delete(tm.dirty, key)
+			tm.missLocked()
+		}
+		tm.mu.Unlock()
+	}
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	for {
+		p := atomic.LoadPointer(&e.p)
+		if p == nil || p == expunged {
+			var zero V
+			return zero, false
+		}
+		if atomic.CompareAndSwapPointer(&e.p, p, nil) {
+			return *(*V)(p), true
+		}
+	}
+}
+
+// Delete 删除key关联的value。
+func (tm *TypedMap[K, V]) Delete(key K) {
+	tm.LoadAndDelete(key)
+}
+
+// Swap 无条件替换key关联的value，并返回替换前的value。
+func (tm *TypedMap[K, V]) Swap(key K, value V) (previous V, loaded bool) {
+	read, _ := tm.read.Load().(typedReadOnly[K, V])
+	if e, ok := read.m[key]; ok {
+		for {
+			p := atomic.LoadPointer(&e.p)
+			if p == expunged {
+				break
+			}
+			if atomic.CompareAndSwapPointer(&e.p, p, unsafe.Pointer(&value)) {
+				if p == nil {
+					var zero V
+					return zero, false
+				}
+				return *(*V)(p), true
+			}
+		}
+	}
+
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	read, _ = tm.read.Load().(typedReadOnly[K, V])
+	if e, ok := read.m[key]; ok {
+		if e.unexpungeLocked() {
+			tm.dirty[key] = e
+		}
+		p := atomic.SwapPointer(&e.p, unsafe.Pointer(&value))
+		if p == nil {
+			var zero V
+			return zero, false
+		}
+		return *(*V)(p), true
+	}
+	if e, ok := tm.dirty[key]; ok {
+		tm.missLocked()
+		p := atomic.SwapPointer(&e.p, unsafe.Pointer(&value))
+		if p == nil {
+			var zero V
+			return zero, false
+		}
+		return *(*V)(p), true
+	}
+	if !read.amended {
+		tm.dirtyLocked()
+		tm.read.Store(typedReadOnly[K, V]{m: read.m, amended: true})
+	}
+	tm.dirty[key] = newTypedEntry(value)
+	var zero V
+	return zero, false
+}
+
+// CompareAndSwap 当且仅当key当前的value和old深度相等（reflect.
+// DeepEqual）时，把它替换为new。V只约束为any而非comparable，所以不能
+// 像Map.CompareAndSwap那样直接用==，但仍然通过对entry.p做CAS保证这
+// 次检查+替换相对其他并发写入是原子的。
+func (tm *TypedMap[K, V]) CompareAndSwap(key K, old, new V) bool {
+	read, _ := tm.read.Load().(typedReadOnly[K, V])
+	e, ok := read.m[key]
+	if !ok {
+		if !read.amended {
+			return false
+		}
+		tm.mu.Lock()
+		read, _ = tm.read.Load().(typedReadOnly[K, V])
+		e, ok = read.m[key]
+		if !ok && read.amended {
+			e, ok = tm.dirty[key]
+			tm.missLocked()
+		}
+		tm.mu.Unlock()
+		if !ok {
+			return false
+		}
+	}
+	for {
+		p := atomic.LoadPointer(&e.p)
+		if p == nil || p == expunged || !reflect.DeepEqual(*(*V)(p), old) {
+			return false
+		}
+		nv := new
+		if atomic.CompareAndSwapPointer(&e.p, p, unsafe.Pointer(&nv)) {
+			return true
+		}
+	}
+}
+
+// CompareAndDelete 当且仅当key当前的value和old深度相等时删除该key。
+func (tm *TypedMap[K, V]) CompareAndDelete(key K, old V) bool {
+	read, _ := tm.read.Load().(typedReadOnly[K, V])
+	e, ok := read.m[key]
+	if !ok {
+		if !read.amended {
+			return false
+		}
+		tm.mu.Lock()
+		read, _ = tm.read.Load().(typedReadOnly[K, V])
+		e, ok = read.m[key]
+		if !ok && read.amended {
+			e, ok = tm.dirty[key]
+			tm.missLocked()
+		}
+		tm.mu.Unlock()
+		if !ok {
+			return false
+		}
+	}
+	for {
+		p := atomic.LoadPointer(&e.p)
+		if p == nil || p == expunged || !reflect.DeepEqual(*(*V)(p), old) {
+			return false
+		}
+		if atomic.CompareAndSwapPointer(&e.p, p, nil) {
+			return true
+		}
+	}
+}
+
+// Range 按Map.Range同样的弱一致性语义遍历所有key/value。
+func (tm *TypedMap[K, V]) Range(f func(key K, value V) bool) {
+	read, _ := tm.read.Load().(typedReadOnly[K, V])
+	if read.amended {
+		tm.mu.Lock()
+		read, _ = tm.read.Load().(typedReadOnly[K, V])
+		if read.amended {
+			read = typedReadOnly[K, V]{m: tm.dirty}
+			tm.read.Store(read)
+			tm.dirty = nil
+			tm.misses = 0
+		}
+		tm.mu.Unlock()
+	}
+
+	for k, e := range read.m {
+		v, ok := e.load()
+		if !ok {
+			continue
+		}
+		if !f(k, v) {
+			break
+		}
+	}
+}
+
+// missLocked和Map.missLocked逻辑一致：记一次miss，miss数追上dirty大小
+// 之后把dirty提升为read。
+func (tm *TypedMap[K, V]) missLocked() {
+	tm.misses++
+	if tm.misses < len(tm.dirty) {
+		return
+	}
+	tm.read.Store(typedReadOnly[K, V]{m: tm.dirty})
+	tm.dirty = nil
+	tm.misses = 0
+}
+
+// dirtyLocked和Map.dirtyLocked逻辑一致：从read拷贝出dirty，顺便把已
+// 经删除的entry标记成expunged。
+func (tm *TypedMap[K, V]) dirtyLocked() {
+	if tm.dirty != nil {
+		return
+	}
+	read, _ := tm.read.Load().(typedReadOnly[K, V])
+	tm.dirty = make(map[K]*typedEntry[V], len(read.m))
+	for k, e := range read.m {
+		if !e.tryExpungeLocked() {
+			tm.dirty[k] = e
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package sync
+
+import "testing"
+
+// BenchmarkTypedMapStoreLoad 和 BenchmarkMapStoreLoad 对照着跑，量化
+// TypedMap相对Map到底省了哪一次分配：TypedMap.Store(key, value)把
+// &value（裸的*V）直接塞进entry.p；Map.Store(key, value)则要先把value
+// 装箱成interface{}（产生一次interface{}的数据分配，int这种小整数
+// 还会因为逃逸分析失败而在堆上分配），再把这个interface{}的地址存进
+// entry.p。用 -benchmem 跑能看到 TypedMap 版本 allocs/op 更少。
+func BenchmarkTypedMapStoreLoad(b *testing.B) {
+	var tm TypedMap[int, int]
+	for i := 0; i < b.N; i++ {
+		tm.Store(i, i)
+		tm.Load(i)
+	}
+}
+
+// BenchmarkMapStoreLoad 是上面基准的未泛型对照组。
+func BenchmarkMapStoreLoad(b *testing.B) {
+	var m Map
+	for i := 0; i < b.N; i++ {
+		m.Store(i, i)
+		m.Load(i)
+	}
+}